@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultDoPageSize = 20
+	maxDoPageSize     = 200
+)
+
+// DigitalOceanProvider manages DNS records via the Digital Ocean v2 API.
+type DigitalOceanProvider struct {
+	Token string
+}
+
+// DomainRecordResponse is a response of the Digital Ocean API
+type DomainRecordResponse struct {
+	DomainRecords []DomainRecord `json:"domain_records"`
+	Links         DomainLinks    `json:"links"`
+	Meta          interface{}    `json:"meta"`
+}
+
+// DomainLinks carries the pagination links of a Digital Ocean API response.
+type DomainLinks struct {
+	Pages DomainPageLinks `json:"pages"`
+}
+
+// DomainPageLinks holds the neighbouring page URLs of a paginated response.
+type DomainPageLinks struct {
+	Next string `json:"next"`
+	Prev string `json:"prev"`
+}
+
+// ListRecords queries the Digital Ocean API for all DNS records of a
+// particular domain, following pagination links until every page has been
+// fetched.
+func (p *DigitalOceanProvider) ListRecords(domain string) ([]DomainRecord, error) {
+	pageURL := "https://api.digitalocean.com/v2/domains/" + domain +
+		"/records?page=1&per_page=" + strconv.Itoa(doPageSize())
+
+	var records []DomainRecord
+	for pageURL != "" {
+		page, err := p.getDomainRecordsPage(pageURL)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page.DomainRecords...)
+
+		next := page.Links.Pages.Next
+		if next == "" {
+			break
+		}
+		nextURL, err := url.Parse(next)
+		if err != nil {
+			return nil, err
+		}
+		pageURL = nextURL.String()
+	}
+	return records, nil
+}
+
+// getDomainRecordsPage fetches a single page of the Digital Ocean domain
+// records API.
+func (p *DigitalOceanProvider) getDomainRecordsPage(pageURL string) (*DomainRecordResponse, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+p.Token)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var domainRecordsResponse DomainRecordResponse
+	if err = json.Unmarshal(body, &domainRecordsResponse); err != nil {
+		return nil, err
+	}
+	return &domainRecordsResponse, nil
+}
+
+// doPageSize resolves the configured Digital Ocean API page size, clamped
+// to the range the API accepts.
+func doPageSize() int {
+	switch {
+	case config.DoPageSize <= 0:
+		return defaultDoPageSize
+	case config.DoPageSize > maxDoPageSize:
+		return maxDoPageSize
+	default:
+		return config.DoPageSize
+	}
+}
+
+// UpdateRecord utilizes the Digital Ocean API to patch a DNS record with the
+// data and metadata fields carried by rec.
+func (p *DigitalOceanProvider) UpdateRecord(domain string, rec DomainRecord) error {
+	payload := map[string]interface{}{"data": rec.Data}
+	if rec.TTL != 0 {
+		payload["ttl"] = rec.TTL
+	}
+	if rec.Priority != nil {
+		payload["priority"] = *rec.Priority
+	}
+	if rec.Port != nil {
+		payload["port"] = *rec.Port
+	}
+	if rec.Weight != nil {
+		payload["weight"] = *rec.Weight
+	}
+	if rec.Flags != nil {
+		payload["flags"] = *rec.Flags
+	}
+	if rec.Tag != "" {
+		payload["tag"] = rec.Tag
+	}
+
+	client := &http.Client{}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(
+		"PUT",
+		"https://api.digitalocean.com/v2/domains/"+domain+"/records/"+strconv.Itoa(rec.ID),
+		bytes.NewBuffer(jsonPayload),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+p.Token)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	os.Stdout.WriteString(string(body) + "\n")
+	return nil
+}
@@ -1,25 +1,66 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/jasonlvhit/gocron"
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultIPv4CheckURL = "http://ipv4.myexternalip.com/raw"
+	defaultIPv6CheckURL = "http://ipv6.myexternalip.com/raw"
+
+	defaultInterval = 10 * time.Minute
+
+	defaultStateFilePath = "./diy-dyndns-state.json"
+)
+
 type Config struct {
-	Domains []DomainConfig `mapstructure:"domains"`
+	Domains       []DomainConfig `mapstructure:"domains"`
+	DoPageSize    int            `mapstructure:"doPageSize"`
+	Interval      string         `mapstructure:"interval"`
+	StateFilePath string         `mapstructure:"stateFilePath"`
 }
 
 type DomainConfig struct {
-	Domain     string   `mapstructure:"domain"`
-	Subdomains []string `mapstructure:"subdomains"`
+	Domain          string       `mapstructure:"domain"`
+	Subdomains      []RecordSpec `mapstructure:"subdomains"`
+	UseIPv4         bool         `mapstructure:"useIPv4"`
+	UseIPv6         bool         `mapstructure:"useIPv6"`
+	IPv4CheckURL    string       `mapstructure:"ipv4CheckUrl"`
+	IPv6CheckURL    string       `mapstructure:"ipv6CheckUrl"`
+	IPv4CheckURL2   string       `mapstructure:"ipv4CheckUrl2"`
+	IPv6CheckURL2   string       `mapstructure:"ipv6CheckUrl2"`
+	AllowIPv4InIPv6 bool         `mapstructure:"allowIPv4InIPv6"`
+	Provider        string       `mapstructure:"provider"`
+	Username        string       `mapstructure:"username"`
+	Token           string       `mapstructure:"token"`
+}
+
+// RecordSpec describes a DNS record this tool is responsible for keeping up
+// to date. A and AAAA records are updated with the server's external IP;
+// other types are only patched with the metadata fields below.
+type RecordSpec struct {
+	Name     string `mapstructure:"name"`
+	Type     string `mapstructure:"type"`
+	TTL      int    `mapstructure:"ttl"`
+	Priority *int   `mapstructure:"priority"`
+	Port     *int   `mapstructure:"port"`
+	Weight   *int   `mapstructure:"weight"`
+	Flags    *int   `mapstructure:"flags"`
+	Tag      string `mapstructure:"tag"`
 }
 
 // DomainRecord contains information about the domain.
@@ -28,20 +69,25 @@ type DomainRecord struct {
 	Type     string `json:"type"`
 	Name     string `json:"name"`
 	Data     string `json:"data"`
-	Priority int    `json:"priority"`
-	Port     int    `json:"port"`
-	Weight   int    `jsin:"weight"`
+	TTL      int    `json:"ttl,omitempty"`
+	Priority *int   `json:"priority,omitempty"`
+	Port     *int   `json:"port,omitempty"`
+	Weight   *int   `json:"weight,omitempty"`
+	Flags    *int   `json:"flags,omitempty"`
+	Tag      string `json:"tag,omitempty"`
 }
 
-// DomainRecordResponse is a response of the Digital Ocean API
-type DomainRecordResponse struct {
-	DomainRecords []DomainRecord `json:"domain_records"`
-	Links         interface{}    `json:"links"`
-	Meta          interface{}    `jsin:"meta"`
+// IPState is the on-disk record of the last IP address written to each DNS
+// record this tool manages, keyed by ipStateKey(domain, type, name).
+type IPState struct {
+	LastIPs map[string]string `json:"lastIPs"`
 }
 
 var (
 	config *Config
+
+	ipStateMu sync.Mutex
+	ipState   *IPState
 )
 
 func init() {
@@ -51,122 +97,398 @@ func init() {
 		os.Stderr.WriteString(err.Error())
 		os.Exit(1)
 	}
+
+	ipState, err = loadIPState(stateFilePath())
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+}
+
+// stateFilePath resolves the configured state file path, falling back to
+// defaultStateFilePath when unset.
+func stateFilePath() string {
+	if config.StateFilePath == "" {
+		return defaultStateFilePath
+	}
+	return config.StateFilePath
+}
+
+// loadIPState reads the on-disk IP state file, returning an empty state if
+// it doesn't exist yet.
+func loadIPState(path string) (*IPState, error) {
+	state := &IPState{LastIPs: map[string]string{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.LastIPs == nil {
+		state.LastIPs = map[string]string{}
+	}
+	return state, nil
+}
+
+// save persists the IP state file to path.
+func (s *IPState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ipStateKey builds the lastIP cache key for a given (domain, type, name)
+// record tuple.
+func ipStateKey(domain string, recordType string, name string) string {
+	return domain + "|" + recordType + "|" + name
+}
+
+// getLastIP returns the last IP address written to the record identified by
+// key, or "" if none is cached.
+func getLastIP(key string) string {
+	ipStateMu.Lock()
+	defer ipStateMu.Unlock()
+	return ipState.LastIPs[key]
+}
+
+// setLastIP records ip as the last value written to the record identified
+// by key and persists the state file.
+func setLastIP(key string, ip string) {
+	ipStateMu.Lock()
+	defer ipStateMu.Unlock()
+	ipState.LastIPs[key] = ip
+	if err := ipState.save(stateFilePath()); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+	}
 }
 
 func main() {
-	token := os.Getenv("DO_TOKEN")
-	if token != "" {
-		for _, domainConfig := range config.Domains {
-			gocron.Every(10).Minutes().Do(func() { CheckDomain(&domainConfig, token) })
-			<-gocron.Start()
-		}
-	} else {
-		os.Stderr.WriteString("Env variables are not configured correctly.\n")
+	once := flag.Bool("once", false, "run a single pass over all configured domains and exit")
+	flag.Parse()
+
+	interval, err := parseInterval(config.Interval)
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
 	}
+
+	runAll()
+	if *once {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-ticker.C:
+			runAll()
+		case <-sigs:
+			return
+		}
+	}
 }
 
-// CheckDomain checks the IP address assigned to the domain and its subdomains,
-// compares it to the real IP address of the server and
-// orders to change the DNS record if needed.
-func CheckDomain(config *DomainConfig, token string) {
-	externalIP, err := GetExternalIP()
+// runAll runs one pass of CheckDomain over every configured domain,
+// concurrently, and waits for all of them to finish.
+func runAll() {
+	var wg sync.WaitGroup
+	for _, domainConfig := range config.Domains {
+		domainConfig := domainConfig
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			CheckDomain(&domainConfig)
+		}()
+	}
+	wg.Wait()
+}
+
+// parseInterval parses the configured interval duration string,
+// falling back to defaultInterval when unset.
+func parseInterval(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultInterval, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// CheckDomain checks the IP address(es) assigned to the domain and its subdomains,
+// compares them to the real IP address(es) of the server and
+// orders to change the DNS record(s) if needed.
+func CheckDomain(config *DomainConfig) {
+	provider, err := NewProvider(config)
 	if err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		return
 	}
-	os.Stdout.WriteString("External IP: " + externalIP + "\n")
-	domainRecords, err := GetDomainRecords(config.Domain, token)
+
+	useIPv4 := config.UseIPv4 || (!config.UseIPv4 && !config.UseIPv6)
+	useIPv6 := config.UseIPv6
+
+	var externalIPv4, externalIPv6 string
+
+	if useIPv4 {
+		var err error
+		externalIPv4, err = confirmedExternalIPv4(config)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			useIPv4 = false
+		} else {
+			os.Stdout.WriteString("External IPv4: " + externalIPv4 + "\n")
+		}
+	}
+
+	if useIPv6 {
+		var err error
+		externalIPv6, err = confirmedExternalIPv6(config)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			useIPv6 = false
+		} else {
+			os.Stdout.WriteString("External IPv6: " + externalIPv6 + "\n")
+		}
+	}
+
+	if !useIPv4 && !useIPv6 {
+		return
+	}
+
+	domainRecords, err := provider.ListRecords(config.Domain)
 	if err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		return
 	}
-	for _, record := range domainRecords {
-		CheckRecord(config, record, "@", externalIP, token)
-		for _, subdomain := range config.Subdomains {
-			CheckRecord(config, record, subdomain, externalIP, token)
-		}
+
+	specs := apexRecordSpecs(useIPv4, useIPv6)
+	specs = append(specs, config.Subdomains...)
+
+	for _, spec := range specs {
+		CheckRecord(config, provider, domainRecords, spec, externalIPv4, externalIPv6)
+	}
+}
+
+// apexRecordSpecs builds the implicit A/AAAA specs for the apex ("@") record,
+// one per address family currently enabled.
+func apexRecordSpecs(useIPv4 bool, useIPv6 bool) []RecordSpec {
+	var specs []RecordSpec
+	if useIPv4 {
+		specs = append(specs, RecordSpec{Name: "@", Type: "A"})
+	}
+	if useIPv6 {
+		specs = append(specs, RecordSpec{Name: "@", Type: "AAAA"})
 	}
+	return specs
 }
 
-func CheckRecord(config *DomainConfig, record DomainRecord, recordName string, externalIP string, token string) {
-	if record.Type == "A" && record.Name == recordName {
+// CheckRecord finds the domain record matching spec's (Type, Name) tuple and
+// patches it if its data or metadata has drifted from spec. A/AAAA records
+// are kept in sync with the server's external IP; other record types only
+// have their metadata fields (TTL, priority, port, weight, flags, tag)
+// patched. An A/AAAA record whose data already equals both the external IP
+// and the cached last IP is left untouched, even if its metadata differs
+// from spec.
+func CheckRecord(config *DomainConfig, provider Provider, domainRecords []DomainRecord, spec RecordSpec, externalIPv4 string, externalIPv6 string) {
+	for _, record := range domainRecords {
+		if record.Type != spec.Type || record.Name != spec.Name {
+			continue
+		}
 		os.Stdout.WriteString(record.Name + " " + record.Data + "\n")
-		if externalIP != record.Data {
-			SetDomainRecord(config.Domain, record.ID, externalIP, token)
+
+		isIPDriven := spec.Type == "A" || spec.Type == "AAAA"
+
+		data := record.Data
+		switch spec.Type {
+		case "A":
+			data = externalIPv4
+		case "AAAA":
+			data = externalIPv6
+		}
+		if isIPDriven && data == "" {
+			// The address family is disabled or its probe failed this round;
+			// leave the record alone rather than patching it with no data.
+			return
+		}
+
+		// The last-IP cache only tracks A/AAAA data; other record types are
+		// always re-evaluated against recordNeedsUpdate so metadata edits
+		// (TTL, priority, port, weight, flags, tag) keep taking effect.
+		key := ipStateKey(config.Domain, spec.Type, spec.Name)
+		if isIPDriven && data == record.Data && data == getLastIP(key) {
+			return
+		}
+
+		patch := DomainRecord{
+			ID:       record.ID,
+			Type:     record.Type,
+			Name:     record.Name,
+			Data:     data,
+			TTL:      spec.TTL,
+			Priority: spec.Priority,
+			Port:     spec.Port,
+			Weight:   spec.Weight,
+			Flags:    spec.Flags,
+			Tag:      spec.Tag,
+		}
+
+		if recordNeedsUpdate(record, patch) {
+			if err := provider.UpdateRecord(config.Domain, patch); err != nil {
+				os.Stderr.WriteString(err.Error() + "\n")
+				return
+			}
+		}
+		if isIPDriven {
+			setLastIP(key, data)
 		}
+		return
+	}
+}
+
+// recordNeedsUpdate reports whether patch carries any value that differs
+// from the existing record. Metadata fields left unset in patch (zero TTL,
+// nil pointers, empty tag) are not compared, so a spec can touch only the
+// fields it cares about.
+func recordNeedsUpdate(record DomainRecord, patch DomainRecord) bool {
+	if record.Data != patch.Data {
+		return true
+	}
+	if patch.TTL != 0 && record.TTL != patch.TTL {
+		return true
+	}
+	if patch.Priority != nil && (record.Priority == nil || *record.Priority != *patch.Priority) {
+		return true
+	}
+	if patch.Port != nil && (record.Port == nil || *record.Port != *patch.Port) {
+		return true
+	}
+	if patch.Weight != nil && (record.Weight == nil || *record.Weight != *patch.Weight) {
+		return true
+	}
+	if patch.Flags != nil && (record.Flags == nil || *record.Flags != *patch.Flags) {
+		return true
+	}
+	if patch.Tag != "" && record.Tag != patch.Tag {
+		return true
 	}
+	return false
 }
 
-// GetExternalIP checks the external IP of the server
-// using the external service
-func GetExternalIP() (string, error) {
-	res, err := http.Get("http://myexternalip.com/raw")
+// confirmedExternalIPv4 resolves the server's external IPv4 address, requiring
+// agreement between two probes (the configured second check URL when set, or
+// a repeat probe of the primary URL otherwise) before trusting the result.
+// This guards against a single flaky response from the check service.
+func confirmedExternalIPv4(config *DomainConfig) (string, error) {
+	checkURL := config.IPv4CheckURL
+	if checkURL == "" {
+		checkURL = defaultIPv4CheckURL
+	}
+	secondURL := config.IPv4CheckURL2
+	if secondURL == "" {
+		secondURL = checkURL
+	}
+
+	first, err := GetExternalIPv4(checkURL)
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
+	second, err := GetExternalIPv4(secondURL)
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(string(body)), nil
+	if first != second {
+		return "", errors.New("external IPv4 probes disagree (" + first + " vs " + second + "), skipping this round")
+	}
+	return first, nil
 }
 
-// GetDomainRecords queries Digital Ocean API for DNS records for a particular domain
-func GetDomainRecords(domain string, token string) ([]DomainRecord, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(
-		"GET",
-		"https://api.digitalocean.com/v2/domains/"+domain+"/records",
-		nil,
-	)
+// confirmedExternalIPv6 is the IPv6 counterpart of confirmedExternalIPv4.
+func confirmedExternalIPv6(config *DomainConfig) (string, error) {
+	checkURL := config.IPv6CheckURL
+	if checkURL == "" {
+		checkURL = defaultIPv6CheckURL
+	}
+	secondURL := config.IPv6CheckURL2
+	if secondURL == "" {
+		secondURL = checkURL
+	}
+
+	first, err := GetExternalIPv6(checkURL, config.AllowIPv4InIPv6)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := client.Do(req)
+	second, err := GetExternalIPv6(secondURL, config.AllowIPv4InIPv6)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
+	if first != second {
+		return "", errors.New("external IPv6 probes disagree (" + first + " vs " + second + "), skipping this round")
+	}
+	return first, nil
+}
+
+// GetExternalIPv4 checks the external IPv4 address of the server
+// by dialing the check URL over tcp4.
+func GetExternalIPv4(checkURL string) (string, error) {
+	ip, err := getExternalIP(checkURL, "tcp4")
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	var domainRecordsResponse DomainRecordResponse
-	if err = json.Unmarshal(body, &domainRecordsResponse); err != nil {
-		return nil, err
+	if ip.To4() == nil {
+		return "", errors.New("ipv4 check url returned a non-IPv4 address: " + ip.String())
 	}
-	return domainRecordsResponse.DomainRecords, nil
+	return ip.String(), nil
 }
 
-// SetDomainRecord utilizes Digital Ocean API to set a DNS record
-func SetDomainRecord(domain string, recordID int, IP string, token string) error {
-	client := &http.Client{}
-	jsonPayload, _ := json.Marshal(map[string]string{"data": IP})
-	req, err := http.NewRequest(
-		"PUT",
-		"https://api.digitalocean.com/v2/domains/"+domain+"/records/"+strconv.Itoa(recordID),
-		bytes.NewBuffer(jsonPayload),
-	)
+// GetExternalIPv6 checks the external IPv6 address of the server
+// by dialing the check URL over tcp6. An IPv4-mapped response is
+// rejected unless allowIPv4InIPv6 is set.
+func GetExternalIPv6(checkURL string, allowIPv4InIPv6 bool) (string, error) {
+	ip, err := getExternalIP(checkURL, "tcp6")
 	if err != nil {
-		return err
+		return "", err
+	}
+	if ip.To4() != nil && !allowIPv4InIPv6 {
+		return "", errors.New("ipv6 check url returned an IPv4 address: " + ip.String())
 	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := client.Do(req)
+	return ip.String(), nil
+}
+
+// getExternalIP fetches the check URL over the given network ("tcp4" or "tcp6")
+// and parses the response body as an IP address.
+func getExternalIP(checkURL string, network string) (net.IP, error) {
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	res, err := client.Get(checkURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	raw := strings.TrimSpace(string(body))
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, errors.New("check url returned an invalid IP address: " + raw)
 	}
-	os.Stdout.WriteString(string(body) + "\n")
-	return nil
+	return ip, nil
 }
 
 func ParseConfig() (*Config, error) {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const nameComBaseURL = "https://api.name.com"
+
+// NameComProvider manages DNS records via the Name.com JSON API.
+type NameComProvider struct {
+	Username string
+	Token    string
+}
+
+// nameComRecord mirrors the JSON shape of a Name.com DNS record.
+type nameComRecord struct {
+	ID       int    `json:"id"`
+	Host     string `json:"host"`
+	Type     string `json:"type"`
+	Answer   string `json:"answer"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// nameComListResponse is the response of the Name.com "list records" endpoint.
+type nameComListResponse struct {
+	Records []nameComRecord `json:"records"`
+}
+
+// ListRecords queries the Name.com API for all DNS records of a domain.
+func (p *NameComProvider) ListRecords(domain string) ([]DomainRecord, error) {
+	body, err := p.do("GET", "/api/dns/list/"+domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	var listResponse nameComListResponse
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return nil, err
+	}
+	records := make([]DomainRecord, 0, len(listResponse.Records))
+	for _, r := range listResponse.Records {
+		records = append(records, domainRecordFromNameCom(r))
+	}
+	return records, nil
+}
+
+// UpdateRecord patches the existing DNS record identified by rec.ID via the
+// Name.com API, so repeated runs update the record in place instead of
+// creating a duplicate each time.
+func (p *NameComProvider) UpdateRecord(domain string, rec DomainRecord) error {
+	payload := map[string]interface{}{
+		"host":   recordHostForNameCom(rec.Name),
+		"type":   rec.Type,
+		"answer": rec.Data,
+	}
+	if rec.TTL != 0 {
+		payload["ttl"] = rec.TTL
+	}
+	if rec.Priority != nil {
+		payload["priority"] = *rec.Priority
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	path := "/api/dns/update/" + domain + "/" + strconv.Itoa(rec.ID)
+	_, err = p.do("PUT", path, bytes.NewBuffer(jsonPayload))
+	return err
+}
+
+// do issues an authenticated request against the Name.com API and returns
+// the raw response body.
+func (p *NameComProvider) do(method string, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, nameComBaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Api-Username", p.Username)
+	req.Header.Add("Api-Token", p.Token)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// domainRecordFromNameCom converts a Name.com record into the shared
+// DomainRecord shape, mapping its apex host ("") to "@".
+func domainRecordFromNameCom(r nameComRecord) DomainRecord {
+	record := DomainRecord{
+		ID:   r.ID,
+		Type: r.Type,
+		Name: r.Host,
+		Data: r.Answer,
+		TTL:  r.TTL,
+	}
+	if record.Name == "" {
+		record.Name = "@"
+	}
+	if r.Priority != 0 {
+		priority := r.Priority
+		record.Priority = &priority
+	}
+	return record
+}
+
+// recordHostForNameCom converts the shared "@" apex convention back into
+// the empty host Name.com expects.
+func recordHostForNameCom(name string) string {
+	if name == "@" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Provider manages DNS records at a single registrar/DNS host.
+type Provider interface {
+	// ListRecords returns every DNS record currently configured for domain.
+	ListRecords(domain string) ([]DomainRecord, error)
+	// UpdateRecord patches the record identified by rec with its new data
+	// and metadata fields.
+	UpdateRecord(domain string, rec DomainRecord) error
+}
+
+// NewProvider constructs the Provider backing config's domain, sourcing
+// credentials from config first and falling back to environment variables.
+func NewProvider(config *DomainConfig) (Provider, error) {
+	switch config.Provider {
+	case "", "digitalocean":
+		token := config.Token
+		if token == "" {
+			token = os.Getenv("DO_TOKEN")
+		}
+		if token == "" {
+			return nil, errors.New("digitalocean provider: no API token configured (set token or DO_TOKEN)")
+		}
+		return &DigitalOceanProvider{Token: token}, nil
+	case "name":
+		username := config.Username
+		if username == "" {
+			username = os.Getenv("NAMECOM_USERNAME")
+		}
+		token := config.Token
+		if token == "" {
+			token = os.Getenv("NAMECOM_TOKEN")
+		}
+		if username == "" || token == "" {
+			return nil, errors.New("name provider: no API credentials configured (set username/token or NAMECOM_USERNAME/NAMECOM_TOKEN)")
+		}
+		return &NameComProvider{Username: username, Token: token}, nil
+	case "cloudflare":
+		return nil, errors.New("cloudflare provider is not yet implemented")
+	default:
+		return nil, errors.New("unknown provider: " + config.Provider)
+	}
+}